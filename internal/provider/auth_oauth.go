@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/smtp"
+	"os/exec"
+	"strings"
+)
+
+// loginAuth implements the non-standardized but widely deployed LOGIN SASL
+// mechanism, in which the server prompts for the username and password as two
+// separate continuations instead of combining them into a single message.
+type loginAuth struct {
+	username, password string
+}
+
+func newLoginAuth(username, password string) smtp.Auth {
+	return &loginAuth{username: username, password: password}
+}
+
+func (a *loginAuth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("smtp: unexpected LOGIN server prompt: %q", fromServer)
+	}
+}
+
+// xoauth2Auth implements XOAUTH2, the mechanism used by Gmail and Office 365
+// to authenticate with an OAuth2 access token instead of a password.
+type xoauth2Auth struct {
+	username, token string
+}
+
+func newXOAuth2Auth(username, token string) smtp.Auth {
+	return &xoauth2Auth{username: username, token: token}
+}
+
+func (a *xoauth2Auth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.token)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+// xoauth2ErrorResponse is the JSON payload a server sends back, as a
+// continuation, when the bearer token is rejected.
+type xoauth2ErrorResponse struct {
+	Status  int    `json:"status"`
+	Schemes string `json:"schemes"`
+	Scope   string `json:"scope"`
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	var errResp xoauth2ErrorResponse
+	if err := json.Unmarshal(fromServer, &errResp); err == nil {
+		return nil, fmt.Errorf("smtp: XOAUTH2 authentication failed: %s", fromServer)
+	}
+
+	// The client must still respond, even though there's nothing more to say,
+	// before the server reports the final failure.
+	return []byte(""), nil
+}
+
+// failedAuth is an smtp.Auth that always fails with err, used to surface a
+// token_command failure through the normal authentication error path.
+type failedAuth struct {
+	err error
+}
+
+func (a failedAuth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	return "", nil, a.err
+}
+
+func (a failedAuth) Next(_ []byte, _ bool) ([]byte, error) {
+	return nil, a.err
+}
+
+// resolveOAuthToken returns the OAuth2 access token to use, running
+// tokenCommand to obtain a fresh one if it's set. It is invoked every time a
+// connection is authenticated rather than once at provider configuration time,
+// since access tokens commonly expire well within the span of a single
+// Terraform run.
+func resolveOAuthToken(token, tokenCommand string) (string, error) {
+	if tokenCommand == "" {
+		return token, nil
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", tokenCommand)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("token_command failed: %w (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
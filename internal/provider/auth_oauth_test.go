@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestResolveOAuthToken_Static(t *testing.T) {
+	got, err := resolveOAuthToken("static-token", "")
+	if err != nil {
+		t.Fatalf("resolveOAuthToken: %v", err)
+	}
+	if got != "static-token" {
+		t.Errorf("got %q, want %q", got, "static-token")
+	}
+}
+
+func TestResolveOAuthToken_Command(t *testing.T) {
+	got, err := resolveOAuthToken("", "echo refreshed-token")
+	if err != nil {
+		t.Fatalf("resolveOAuthToken: %v", err)
+	}
+	if got != "refreshed-token" {
+		t.Errorf("got %q, want %q", got, "refreshed-token")
+	}
+}
+
+func TestResolveOAuthToken_CommandFailure(t *testing.T) {
+	_, err := resolveOAuthToken("", "exit 1")
+	if err == nil {
+		t.Fatal("expected an error from a failing token_command, got nil")
+	}
+}
+
+func TestXOAuth2Auth_Start(t *testing.T) {
+	a := newXOAuth2Auth("user@example.com", "my-token")
+	mech, resp, err := a.Start(nil)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mech != "XOAUTH2" {
+		t.Errorf("mechanism = %q, want XOAUTH2", mech)
+	}
+
+	want := "user=user@example.com\x01auth=Bearer my-token\x01\x01"
+	if string(resp) != want {
+		t.Errorf("Start response = %q, want %q", resp, want)
+	}
+}
+
+func TestXOAuth2Auth_NextError(t *testing.T) {
+	a := newXOAuth2Auth("user@example.com", "my-token")
+	if _, err := a.Next([]byte(`{"status":401,"schemes":"Bearer","scope":""}`), true); err == nil {
+		t.Fatal("expected an error for a server error continuation, got nil")
+	}
+}
+
+func TestLoginAuth_Next(t *testing.T) {
+	a := newLoginAuth("user@example.com", "hunter2")
+
+	username, err := a.Next([]byte("Username:"), true)
+	if err != nil || string(username) != "user@example.com" {
+		t.Errorf("Next(Username:) = %q, %v", username, err)
+	}
+
+	password, err := a.Next([]byte("Password:"), true)
+	if err != nil || string(password) != "hunter2" {
+		t.Errorf("Next(Password:) = %q, %v", password, err)
+	}
+
+	if _, err := a.Next([]byte("Something else:"), true); err == nil {
+		t.Fatal("expected an error for an unrecognized LOGIN prompt, got nil")
+	}
+}
+
+func TestFailedAuth(t *testing.T) {
+	a := failedAuth{err: errUnused}
+	if _, _, err := a.Start(nil); err != errUnused {
+		t.Errorf("Start() error = %v, want %v", err, errUnused)
+	}
+	if _, err := a.Next(nil, true); err != errUnused {
+		t.Errorf("Next() error = %v, want %v", err, errUnused)
+	}
+}
+
+var errUnused = &testError{"boom"}
+
+type testError struct{ msg string }
+
+func (e *testError) Error() string { return e.msg }
@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramAuth implements the client side of the SCRAM-SHA-1, SCRAM-SHA-256 and
+// their channel-binding "-PLUS" variants, as defined in RFC 5802 and RFC 7677.
+type scramAuth struct {
+	mechanism string
+	newHash   func() hash.Hash
+	username  string
+	password  string
+
+	// cbindData is the channel binding data (tls-server-end-point) to embed
+	// in the gs2 header of the -PLUS variants. It is nil for the plain variants.
+	cbindData []byte
+
+	step        int
+	clientNonce string
+	gs2Header   string
+	clientFirst string
+	authMessage string
+	saltedPass  []byte
+}
+
+func newScramAuth(mechanism string, newHash func() hash.Hash, username, password string, cbindData []byte) smtp.Auth {
+	return &scramAuth{
+		mechanism: mechanism,
+		newHash:   newHash,
+		username:  username,
+		password:  password,
+		cbindData: cbindData,
+	}
+}
+
+func (a *scramAuth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, fmt.Errorf("failed to generate client nonce: %w", err)
+	}
+	a.clientNonce = base64.StdEncoding.EncodeToString(nonce)
+
+	if a.cbindData != nil {
+		a.gs2Header = "p=tls-server-end-point,,"
+	} else {
+		a.gs2Header = "n,,"
+	}
+
+	a.clientFirst = fmt.Sprintf("n=%s,r=%s", escapeScramName(a.username), a.clientNonce)
+
+	return a.mechanism, []byte(a.gs2Header + a.clientFirst), nil
+}
+
+func (a *scramAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch a.step {
+	case 0:
+		a.step++
+		return a.handleServerFirst(fromServer)
+	case 1:
+		a.step++
+		return a.handleServerFinal(fromServer)
+	default:
+		return nil, errors.New("smtp: unexpected SCRAM challenge")
+	}
+}
+
+func (a *scramAuth) handleServerFirst(serverFirst []byte) ([]byte, error) {
+	fields := parseScramFields(string(serverFirst))
+
+	combinedNonce, ok := fields["r"]
+	if !ok || !strings.HasPrefix(combinedNonce, a.clientNonce) {
+		return nil, errors.New("smtp: server sent invalid SCRAM nonce")
+	}
+
+	saltB64, ok := fields["s"]
+	if !ok {
+		return nil, errors.New("smtp: server did not send a SCRAM salt")
+	}
+	salt, err := base64.StdEncoding.DecodeString(saltB64)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: invalid SCRAM salt: %w", err)
+	}
+
+	iterCountStr, ok := fields["i"]
+	if !ok {
+		return nil, errors.New("smtp: server did not send a SCRAM iteration count")
+	}
+	iterCount, err := strconv.Atoi(iterCountStr)
+	if err != nil || iterCount <= 0 {
+		return nil, fmt.Errorf("smtp: invalid SCRAM iteration count: %q", iterCountStr)
+	}
+
+	hashSize := a.newHash().Size()
+	a.saltedPass = pbkdf2.Key([]byte(a.password), salt, iterCount, hashSize, a.newHash)
+
+	channelBinding := a.gs2Header
+	if a.cbindData != nil {
+		channelBinding += string(a.cbindData)
+	}
+	cbindInput := base64.StdEncoding.EncodeToString([]byte(channelBinding))
+
+	clientFinalWithoutProof := fmt.Sprintf("c=%s,r=%s", cbindInput, combinedNonce)
+	a.authMessage = fmt.Sprintf("%s,%s,%s", a.clientFirst, string(serverFirst), clientFinalWithoutProof)
+
+	clientKey := a.hmac(a.saltedPass, "Client Key")
+	storedKey := a.hash(clientKey)
+	clientSignature := a.hmac(storedKey, a.authMessage)
+	clientProof := xorBytes(clientKey, clientSignature)
+
+	clientFinal := fmt.Sprintf("%s,p=%s", clientFinalWithoutProof, base64.StdEncoding.EncodeToString(clientProof))
+
+	return []byte(clientFinal), nil
+}
+
+func (a *scramAuth) handleServerFinal(serverFinal []byte) ([]byte, error) {
+	fields := parseScramFields(string(serverFinal))
+
+	if errMsg, ok := fields["e"]; ok {
+		return nil, fmt.Errorf("smtp: SCRAM authentication failed: %s", errMsg)
+	}
+
+	wantSignature, ok := fields["v"]
+	if !ok {
+		return nil, errors.New("smtp: server did not send a SCRAM verifier")
+	}
+
+	serverKey := a.hmac(a.saltedPass, "Server Key")
+	serverSignature := a.hmac(serverKey, a.authMessage)
+
+	if base64.StdEncoding.EncodeToString(serverSignature) != wantSignature {
+		return nil, errors.New("smtp: server signature mismatch, possible man-in-the-middle attack")
+	}
+
+	return []byte(""), nil
+}
+
+func (a *scramAuth) hmac(key []byte, message string) []byte {
+	mac := hmac.New(a.newHash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func (a *scramAuth) hash(b []byte) []byte {
+	h := a.newHash()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// escapeScramName escapes a SCRAM "saslname" as required by RFC 5802 section 5.1:
+// "=" becomes "=3D" and "," becomes "=2C".
+func escapeScramName(name string) string {
+	name = strings.ReplaceAll(name, "=", "=3D")
+	name = strings.ReplaceAll(name, ",", "=2C")
+	return name
+}
+
+func parseScramFields(s string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return fields
+}
+
+// tlsServerEndpointBinding computes the "tls-server-end-point" channel binding
+// data defined in RFC 5929 section 4.1: the hash of the server's leaf
+// certificate, using the hash function from the certificate's own signature
+// algorithm (falling back to SHA-256 for certificates signed with MD5, SHA-1,
+// or an algorithm this provider doesn't recognize).
+func tlsServerEndpointBinding(state tls.ConnectionState) ([]byte, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("smtp: no peer certificates available for channel binding")
+	}
+
+	cert := state.PeerCertificates[0]
+	h := hashForSignatureAlgorithm(cert.SignatureAlgorithm)()
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
+// hashForSignatureAlgorithm returns the constructor for the hash function
+// RFC 5929 section 4.1 calls for when binding to a certificate signed with alg.
+func hashForSignatureAlgorithm(alg x509.SignatureAlgorithm) func() hash.Hash {
+	switch alg {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		return sha512.New384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		return sha512.New
+	default:
+		return sha256.New
+	}
+}
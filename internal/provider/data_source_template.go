@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"text/template"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// dataSourceTemplate renders a Go text/template against a map of variables,
+// e.g. to build a message body or subject from shared boilerplate.
+func dataSourceTemplate() *schema.Resource {
+	return &schema.Resource{
+		Description: "Renders a Go text/template against a map of variables",
+		ReadContext: dataSourceTemplateRead,
+		Schema: map[string]*schema.Schema{
+			"template": {
+				Type:        schema.TypeString,
+				Description: "Go text/template source to render",
+				Required:    true,
+			},
+			"vars": {
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Variables made available to the template, accessible as {{ .name }}",
+				Optional:    true,
+			},
+			"rendered": {
+				Type:        schema.TypeString,
+				Description: "The rendered output",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceTemplateRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	source := d.Get("template").(string)
+
+	vars := make(map[string]string)
+	for k, v := range d.Get("vars").(map[string]interface{}) {
+		vars[k] = v.(string)
+	}
+
+	tmpl, err := template.New("smtp_template").Option("missingkey=error").Parse(source)
+	if err != nil {
+		return diag.Errorf("failed to parse template: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return diag.Errorf("failed to render template: %s", err)
+	}
+
+	rendered := buf.String()
+	if err := d.Set("rendered", rendered); err != nil {
+		return diag.FromErr(err)
+	}
+
+	sum := sha256.Sum256([]byte(source + rendered))
+	d.SetId(fmt.Sprintf("%x", sum))
+
+	return nil
+}
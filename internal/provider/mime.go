@@ -0,0 +1,348 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// messageAttachment describes a single attachment or inline (CID-referenced)
+// part of an outgoing message.
+type messageAttachment struct {
+	filename    string
+	contentType string
+	content     []byte
+	inline      bool
+	contentID   string
+}
+
+// messageInput holds everything needed to render an RFC 5322 / MIME message,
+// independent of how it is eventually handed to an SMTP server.
+type messageInput struct {
+	from, subject string
+	to, cc        []string
+	headers       map[string]string
+	textBody      string
+	htmlBody      string
+	attachments   []messageAttachment
+}
+
+// mimePart is a single entity of a MIME message: the headers that describe it
+// and its already-encoded body.
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// renderMessage renders in into a complete RFC 5322 message, MIME-wrapping it
+// as multipart/mixed, multipart/alternative and/or multipart/related as
+// needed, and returns the raw bytes ready to hand to an SMTP DATA command.
+func renderMessage(in messageInput) ([]byte, error) {
+	seed := boundarySeed(in)
+	inlineImages, attachments := splitAttachments(in.attachments)
+
+	content, err := renderBody(in, seed, inlineImages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attachments) > 0 {
+		parts := append([]mimePart{content}, attachmentParts(attachments)...)
+		content, err = multipartOf("mixed", boundaryID(seed, "mixed"), parts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return assembleMessage(in, content)
+}
+
+// renderBody renders the text/html portion of the message, independent of any
+// top-level attachments.
+func renderBody(in messageInput, seed []byte, inlineImages []messageAttachment) (mimePart, error) {
+	switch {
+	case in.textBody != "" && in.htmlBody != "":
+		textPart, err := encodedTextPart("text/plain", in.textBody)
+		if err != nil {
+			return mimePart{}, err
+		}
+		htmlPart, err := renderHTMLPart(in.htmlBody, inlineImages, seed)
+		if err != nil {
+			return mimePart{}, err
+		}
+		return multipartOf("alternative", boundaryID(seed, "alternative"), []mimePart{textPart, htmlPart})
+	case in.htmlBody != "":
+		return renderHTMLPart(in.htmlBody, inlineImages, seed)
+	default:
+		return encodedTextPart("text/plain", in.textBody)
+	}
+}
+
+// renderHTMLPart renders the HTML body, wrapping it in multipart/related with
+// its inline images if there are any.
+func renderHTMLPart(htmlBody string, inlineImages []messageAttachment, seed []byte) (mimePart, error) {
+	htmlPart, err := encodedTextPart("text/html", htmlBody)
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	if len(inlineImages) == 0 {
+		return htmlPart, nil
+	}
+
+	parts := append([]mimePart{htmlPart}, attachmentParts(inlineImages)...)
+	return multipartOf("related", boundaryID(seed, "related"), parts)
+}
+
+// encodedTextPart quoted-printable encodes text and wraps it as a single MIME
+// part with the given content type (e.g. "text/plain").
+func encodedTextPart(contentType, text string) (mimePart, error) {
+	buf := &bytes.Buffer{}
+	qw := quotedprintable.NewWriter(buf)
+	if _, err := qw.Write([]byte(text)); err != nil {
+		return mimePart{}, fmt.Errorf("failed to quoted-printable encode %s part: %w", contentType, err)
+	}
+	if err := qw.Close(); err != nil {
+		return mimePart{}, fmt.Errorf("failed to finalize %s part: %w", contentType, err)
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("%s; charset=UTF-8", contentType))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	return mimePart{header: header, body: buf.Bytes()}, nil
+}
+
+// attachmentParts base64-encodes every attachment into its own MIME part.
+func attachmentParts(attachments []messageAttachment) []mimePart {
+	parts := make([]mimePart, len(attachments))
+	for i, a := range attachments {
+		parts[i] = attachmentPart(a)
+	}
+	return parts
+}
+
+func attachmentPart(a messageAttachment) mimePart {
+	contentType := a.contentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("%s; name=%s", contentType, quoteParam(a.filename)))
+	header.Set("Content-Transfer-Encoding", "base64")
+	if a.inline {
+		header.Set("Content-Disposition", fmt.Sprintf("inline; filename=%s", quoteParam(a.filename)))
+		header.Set("Content-ID", fmt.Sprintf("<%s>", a.contentID))
+	} else {
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", quoteParam(a.filename)))
+	}
+
+	return mimePart{header: header, body: base64Wrap(a.content)}
+}
+
+// multipartOf wraps parts into a single MIME part of multipart/<kind>,
+// rendering the given boundary using the standard library's multipart writer
+// so the encoding itself stays RFC 2046 compliant.
+func multipartOf(kind, boundary string, parts []mimePart) (mimePart, error) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return mimePart{}, fmt.Errorf("failed to set multipart/%s boundary: %w", kind, err)
+	}
+
+	for _, p := range parts {
+		pw, err := mw.CreatePart(p.header)
+		if err != nil {
+			return mimePart{}, fmt.Errorf("failed to create multipart/%s part: %w", kind, err)
+		}
+		if _, err := pw.Write(p.body); err != nil {
+			return mimePart{}, fmt.Errorf("failed to write multipart/%s part: %w", kind, err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return mimePart{}, fmt.Errorf("failed to close multipart/%s writer: %w", kind, err)
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("multipart/%s; boundary=%s", kind, boundary))
+
+	return mimePart{header: header, body: buf.Bytes()}, nil
+}
+
+// assembleMessage writes the RFC 5322 envelope headers followed by the
+// top-level MIME part.
+func assembleMessage(in messageInput, content mimePart) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	if err := writeHeader(buf, "From", encodeAddressHeader(in.from)); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(buf, "Subject", encodeTextHeader(in.subject)); err != nil {
+		return nil, err
+	}
+	if len(in.to) > 0 {
+		if err := writeHeader(buf, "To", encodeAddressList(in.to)); err != nil {
+			return nil, err
+		}
+	}
+	if len(in.cc) > 0 {
+		if err := writeHeader(buf, "Cc", encodeAddressList(in.cc)); err != nil {
+			return nil, err
+		}
+	}
+
+	headerNames := make([]string, 0, len(in.headers))
+	for k := range in.headers {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	for _, k := range headerNames {
+		if err := writeHeader(buf, k, encodeTextHeader(in.headers[k])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeHeader(buf, "MIME-Version", "1.0"); err != nil {
+		return nil, err
+	}
+	if err := writeHeader(buf, "Content-Type", content.header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+	if cte := content.header.Get("Content-Transfer-Encoding"); cte != "" {
+		if err := writeHeader(buf, "Content-Transfer-Encoding", cte); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := buf.WriteString("\r\n"); err != nil {
+		return nil, err
+	}
+
+	if _, err := buf.Write(content.body); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) error {
+	_, err := fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+	return err
+}
+
+// encodeTextHeader RFC 2047 encodes value as one or more encoded-words if it
+// contains non-ASCII characters, leaving plain ASCII values untouched.
+func encodeTextHeader(value string) string {
+	if isASCII(value) {
+		return value
+	}
+	return mime.QEncoding.Encode("UTF-8", value)
+}
+
+// encodeAddressHeader encodes the display name of a "Name <addr>" value using
+// net/mail, which RFC 2047 encodes non-ASCII display names while leaving the
+// address itself untouched. Values that don't parse as an address are encoded
+// as plain text instead.
+func encodeAddressHeader(value string) string {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return encodeTextHeader(value)
+	}
+	return addr.String()
+}
+
+// encodeAddressList RFC 2047 encodes each address in addrs the same way
+// encodeAddressHeader does, then joins them for a "To"/"Cc" header.
+func encodeAddressList(addrs []string) string {
+	encoded := make([]string, len(addrs))
+	for i, addr := range addrs {
+		encoded[i] = encodeAddressHeader(addr)
+	}
+	return strings.Join(encoded, ", ")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteParam quotes a MIME parameter value (e.g. a filename) per RFC 2045.
+func quoteParam(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// base64Wrap base64-encodes data and wraps it at the 76-column limit required
+// by RFC 2045 for the base64 Content-Transfer-Encoding.
+func base64Wrap(data []byte) []byte {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var out bytes.Buffer
+	for len(encoded) > lineLength {
+		out.WriteString(encoded[:lineLength])
+		out.WriteString("\r\n")
+		encoded = encoded[lineLength:]
+	}
+	out.WriteString(encoded)
+	out.WriteString("\r\n")
+
+	return out.Bytes()
+}
+
+// splitAttachments separates the inline (CID-referenced) attachments from the
+// regular ones, preserving their relative order.
+func splitAttachments(attachments []messageAttachment) (inline, regular []messageAttachment) {
+	for _, a := range attachments {
+		if a.inline {
+			inline = append(inline, a)
+		} else {
+			regular = append(regular, a)
+		}
+	}
+	return inline, regular
+}
+
+// boundarySeed derives a stable seed from the message contents so that
+// boundaries (and therefore the rendered message bytes) are deterministic for
+// a given configuration.
+func boundarySeed(in messageInput) []byte {
+	h := sha256.New()
+	h.Write([]byte(in.from))
+	h.Write([]byte(in.subject))
+	h.Write([]byte(in.textBody))
+	h.Write([]byte(in.htmlBody))
+	for _, r := range in.to {
+		h.Write([]byte(r))
+	}
+	for _, r := range in.cc {
+		h.Write([]byte(r))
+	}
+	for _, a := range in.attachments {
+		h.Write([]byte(a.filename))
+		h.Write(a.content)
+	}
+	return h.Sum(nil)
+}
+
+func boundaryID(seed []byte, label string) string {
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte(label))
+	sum := h.Sum(nil)
+	return fmt.Sprintf("smtp-%x", sum[:12])
+}
@@ -0,0 +1,199 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestEncodeTextHeader(t *testing.T) {
+	if got := encodeTextHeader("Hello World!"); got != "Hello World!" {
+		t.Errorf("ASCII subject was altered: got %q", got)
+	}
+
+	got := encodeTextHeader("José")
+	if !strings.HasPrefix(got, "=?UTF-8?") {
+		t.Errorf("non-ASCII subject wasn't RFC 2047 encoded: got %q", got)
+	}
+}
+
+func TestEncodeAddressHeader(t *testing.T) {
+	got := encodeAddressHeader(`"José" <jose@example.com>`)
+	if !strings.Contains(got, "=?utf-8?") && !strings.Contains(got, "=?UTF-8?") {
+		t.Errorf("non-ASCII display name wasn't RFC 2047 encoded: got %q", got)
+	}
+	if !strings.Contains(got, "<jose@example.com>") {
+		t.Errorf("address itself was altered: got %q", got)
+	}
+}
+
+// TestEncodeAddressList is a regression test: assembleMessage used to join
+// "to"/"cc" with a raw strings.Join, skipping RFC 2047 encoding entirely.
+func TestEncodeAddressList(t *testing.T) {
+	got := encodeAddressList([]string{`"José" <jose@example.com>`, "plain@example.com"})
+
+	if !isASCII(got) {
+		t.Fatalf("encoded address list must be US-ASCII, got %q", got)
+	}
+	if !strings.Contains(got, "<jose@example.com>") || !strings.Contains(got, "plain@example.com") {
+		t.Fatalf("addresses themselves were altered: got %q", got)
+	}
+}
+
+func TestQuoteParam(t *testing.T) {
+	if got := quoteParam(`a"b`); got != `"a\"b"` {
+		t.Errorf("quoteParam(%q) = %q", `a"b`, got)
+	}
+}
+
+func TestBoundaryID_Deterministic(t *testing.T) {
+	in := messageInput{from: "a@example.com", subject: "s", textBody: "body"}
+	seed1 := boundarySeed(in)
+	seed2 := boundarySeed(in)
+
+	if boundaryID(seed1, "mixed") != boundaryID(seed2, "mixed") {
+		t.Fatal("boundaryID is not deterministic for identical input")
+	}
+	if boundaryID(seed1, "mixed") == boundaryID(seed1, "alternative") {
+		t.Fatal("boundaryID must differ by label")
+	}
+}
+
+func TestIsASCII(t *testing.T) {
+	if !isASCII("plain text") {
+		t.Error("isASCII(plain text) = false")
+	}
+	if isASCII("José") {
+		t.Error("isASCII(José) = true")
+	}
+}
+
+// TestRenderMessage_MultipartStructure renders a message with an HTML
+// alternative, a regular attachment and an inline CID image, then re-parses
+// the output with mime/multipart to confirm it produces a valid
+// multipart/mixed(multipart/alternative(text/plain, multipart/related(text/html, inline image)), attachment).
+func TestRenderMessage_MultipartStructure(t *testing.T) {
+	logo := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+	csv := []byte("a,b\n1,2\n")
+
+	in := messageInput{
+		from:     "sender@example.com",
+		subject:  "Report",
+		to:       []string{"recipient@example.com"},
+		textBody: "Plain body",
+		htmlBody: `<html><body><img src="cid:logo"></body></html>`,
+		attachments: []messageAttachment{
+			{filename: "report.csv", contentType: "text/csv", content: csv},
+			{filename: "logo.png", contentType: "image/png", content: logo, inline: true, contentID: "logo"},
+		},
+	}
+
+	rendered, err := renderMessage(in)
+	if err != nil {
+		t.Fatalf("renderMessage: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(rendered))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage: %v", err)
+	}
+
+	mixedType, mixedParams := parseContentType(t, msg.Header.Get("Content-Type"))
+	if mixedType != "multipart/mixed" {
+		t.Fatalf("top-level Content-Type = %q, want multipart/mixed", mixedType)
+	}
+	mixed := multipart.NewReader(msg.Body, mixedParams["boundary"])
+
+	altPart := nextPart(t, mixed, "multipart/alternative")
+	_, altParams := parseContentType(t, altPart.Header.Get("Content-Type"))
+	alt := multipart.NewReader(altPart, altParams["boundary"])
+
+	textPart := nextPart(t, alt, "text/plain")
+	if got := decodeQuotedPrintable(t, textPart); got != "Plain body" {
+		t.Errorf("text/plain body = %q, want %q", got, "Plain body")
+	}
+
+	relatedPart := nextPart(t, alt, "multipart/related")
+	_, relatedParams := parseContentType(t, relatedPart.Header.Get("Content-Type"))
+	related := multipart.NewReader(relatedPart, relatedParams["boundary"])
+
+	htmlPart := nextPart(t, related, "text/html")
+	if got := decodeQuotedPrintable(t, htmlPart); got != in.htmlBody {
+		t.Errorf("text/html body = %q, want %q", got, in.htmlBody)
+	}
+
+	imgPart := nextPart(t, related, "image/png")
+	if got := imgPart.Header.Get("Content-ID"); got != "<logo>" {
+		t.Errorf("inline image Content-ID = %q, want <logo>", got)
+	}
+	if got := decodeBase64(t, imgPart); !bytes.Equal(got, logo) {
+		t.Errorf("inline image content round-tripped as %x, want %x", got, logo)
+	}
+	assertNoMoreParts(t, related)
+	assertNoMoreParts(t, alt)
+
+	attachmentPart := nextPart(t, mixed, "text/csv")
+	if disp := attachmentPart.Header.Get("Content-Disposition"); !strings.Contains(disp, `filename="report.csv"`) {
+		t.Errorf("attachment Content-Disposition = %q, want it to name report.csv", disp)
+	}
+	if got := decodeBase64(t, attachmentPart); !bytes.Equal(got, csv) {
+		t.Errorf("attachment content round-tripped as %q, want %q", got, csv)
+	}
+	assertNoMoreParts(t, mixed)
+}
+
+func parseContentType(t *testing.T, header string) (string, map[string]string) {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType(%q): %v", header, err)
+	}
+	return mediaType, params
+}
+
+func nextPart(t *testing.T, r *multipart.Reader, wantType string) *multipart.Part {
+	t.Helper()
+	part, err := r.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart: %v", err)
+	}
+	if gotType, _ := parseContentType(t, part.Header.Get("Content-Type")); gotType != wantType {
+		t.Fatalf("part Content-Type = %q, want %q", gotType, wantType)
+	}
+	return part
+}
+
+func assertNoMoreParts(t *testing.T, r *multipart.Reader) {
+	t.Helper()
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Fatalf("expected no more parts, got err=%v", err)
+	}
+}
+
+func decodeQuotedPrintable(t *testing.T, part *multipart.Part) string {
+	t.Helper()
+	data, err := io.ReadAll(quotedprintable.NewReader(part))
+	if err != nil {
+		t.Fatalf("quoted-printable decode: %v", err)
+	}
+	return string(data)
+}
+
+func decodeBase64(t *testing.T, part *multipart.Part) []byte {
+	t.Helper()
+	raw, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatalf("reading part body: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("base64 decode: %v", err)
+	}
+	return decoded
+}
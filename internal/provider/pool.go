@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"fmt"
+	"net/smtp"
+	"sync"
+)
+
+// smtpPool keeps a single authenticated *smtp.Client alive across multiple
+// resource operations within a terraform apply, so that smtp_mailer and the
+// resources that depend on it don't pay a fresh dial/STARTTLS/AUTH round-trip
+// per message.
+type smtpPool struct {
+	mu   sync.Mutex
+	conn *smtp.Client
+}
+
+// open dials and authenticates the pooled connection if it isn't already
+// open. It is safe to call more than once.
+func (p *smtpPool) open(client *client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		return nil
+	}
+
+	c, err := dialAuthenticated(client)
+	if err != nil {
+		return err
+	}
+
+	p.conn = c
+	return nil
+}
+
+// send delivers msg to recipients over the pooled connection, reconnecting
+// first if it was never opened or has gone stale.
+func (p *smtpPool) send(client *client, recipients []string, msg []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		c, err := dialAuthenticated(client)
+		if err != nil {
+			return err
+		}
+		p.conn = c
+	} else if err := p.conn.Noop(); err != nil {
+		c, dialErr := dialAuthenticated(client)
+		if dialErr != nil {
+			return fmt.Errorf("pooled connection is stale (%w) and could not be reopened: %w", err, dialErr)
+		}
+		p.conn.Close()
+		p.conn = c
+	}
+
+	if err := sendOverClient(p.conn, client.username, recipients, msg); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+// close quits the pooled connection, if any.
+func (p *smtpPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	err := p.conn.Quit()
+	p.conn = nil
+	return err
+}
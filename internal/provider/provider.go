@@ -2,16 +2,32 @@ package provider
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"net/smtp"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func init() {
 	schema.DescriptionKind = schema.StringMarkdown
 }
 
+// authMechanisms lists every top-level auth block accepted by the provider.
+// It is used as the ExactlyOneOf set so that exactly one mechanism is configured.
+var authMechanisms = []string{
+	"cram_md5_auth",
+	"plain_auth",
+	"scram_sha1_auth",
+	"scram_sha256_auth",
+	"scram_sha1_plus_auth",
+	"scram_sha256_plus_auth",
+	"login_auth",
+	"xoauth2_auth",
+}
+
 func New(version string) func() *schema.Provider {
 	return func() *schema.Provider {
 		p := &schema.Provider{
@@ -58,7 +74,7 @@ If not set explicitly, it will default to 587.
 					Description:  "CRAM-MD5 authentication settings as defined in RFC 2195",
 					Optional:     true,
 					MaxItems:     1,
-					ExactlyOneOf: []string{"cram_md5_auth", "plain_auth"},
+					ExactlyOneOf: authMechanisms,
 					Elem: &schema.Resource{
 						Schema: map[string]*schema.Schema{
 							"secret": {
@@ -79,7 +95,7 @@ Can be passed using the SMTP_CRAM_MD5_SECRET environment variable.
 					Description:  "PLAIN authentication settings as defined in RFC 4616",
 					Optional:     true,
 					MaxItems:     1,
-					ExactlyOneOf: []string{"cram_md5_auth", "plain_auth"},
+					ExactlyOneOf: authMechanisms,
 					Elem: &schema.Resource{
 						Schema: map[string]*schema.Schema{
 							"password": {
@@ -106,9 +122,230 @@ Can be passed using the SMTP_PLAIN_IDENTITY environment variable.
 						},
 					},
 				},
+				"scram_sha1_auth": {
+					Type:         schema.TypeList,
+					Description:  "SCRAM-SHA-1 authentication settings as defined in RFC 5802",
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"password": {
+								Type: schema.TypeString,
+								Description: `
+The password to use for authentication.
+Can be passed using the SMTP_SCRAM_SHA1_PASSWORD environment variable.
+								`,
+								DefaultFunc: schema.EnvDefaultFunc("SMTP_SCRAM_SHA1_PASSWORD", nil),
+								Required:    true,
+								Sensitive:   true,
+							},
+						},
+					},
+				},
+				"scram_sha256_auth": {
+					Type:         schema.TypeList,
+					Description:  "SCRAM-SHA-256 authentication settings as defined in RFC 7677",
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"password": {
+								Type: schema.TypeString,
+								Description: `
+The password to use for authentication.
+Can be passed using the SMTP_SCRAM_SHA256_PASSWORD environment variable.
+								`,
+								DefaultFunc: schema.EnvDefaultFunc("SMTP_SCRAM_SHA256_PASSWORD", nil),
+								Required:    true,
+								Sensitive:   true,
+							},
+						},
+					},
+				},
+				"scram_sha1_plus_auth": {
+					Type: schema.TypeList,
+					Description: `
+SCRAM-SHA-1-PLUS authentication settings as defined in RFC 5802.
+This mechanism binds the authentication to the underlying TLS channel and
+therefore requires a TLS-encrypted connection (STARTTLS or implicit TLS).
+					`,
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"password": {
+								Type: schema.TypeString,
+								Description: `
+The password to use for authentication.
+Can be passed using the SMTP_SCRAM_SHA1_PLUS_PASSWORD environment variable.
+								`,
+								DefaultFunc: schema.EnvDefaultFunc("SMTP_SCRAM_SHA1_PLUS_PASSWORD", nil),
+								Required:    true,
+								Sensitive:   true,
+							},
+						},
+					},
+				},
+				"scram_sha256_plus_auth": {
+					Type: schema.TypeList,
+					Description: `
+SCRAM-SHA-256-PLUS authentication settings as defined in RFC 7677.
+This mechanism binds the authentication to the underlying TLS channel and
+therefore requires a TLS-encrypted connection (STARTTLS or implicit TLS).
+					`,
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"password": {
+								Type: schema.TypeString,
+								Description: `
+The password to use for authentication.
+Can be passed using the SMTP_SCRAM_SHA256_PLUS_PASSWORD environment variable.
+								`,
+								DefaultFunc: schema.EnvDefaultFunc("SMTP_SCRAM_SHA256_PLUS_PASSWORD", nil),
+								Required:    true,
+								Sensitive:   true,
+							},
+						},
+					},
+				},
+				"login_auth": {
+					Type:         schema.TypeList,
+					Description:  "LOGIN authentication settings. LOGIN is not standardized but is widely deployed",
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"password": {
+								Type: schema.TypeString,
+								Description: `
+The password to use for authentication.
+Can be passed using the SMTP_LOGIN_PASSWORD environment variable.
+								`,
+								DefaultFunc: schema.EnvDefaultFunc("SMTP_LOGIN_PASSWORD", nil),
+								Required:    true,
+								Sensitive:   true,
+							},
+						},
+					},
+				},
+				"xoauth2_auth": {
+					Type:         schema.TypeList,
+					Description:  "XOAUTH2 authentication settings, as used by Gmail and Office 365",
+					Optional:     true,
+					MaxItems:     1,
+					ExactlyOneOf: authMechanisms,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"token": {
+								Type: schema.TypeString,
+								Description: `
+The OAuth2 access token to use for authentication.
+Can be passed using the SMTP_XOAUTH2_TOKEN environment variable.
+Mutually exclusive with token_command.
+								`,
+								DefaultFunc:   schema.EnvDefaultFunc("SMTP_XOAUTH2_TOKEN", ""),
+								Optional:      true,
+								Sensitive:     true,
+								AtLeastOneOf:  []string{"xoauth2_auth.0.token", "xoauth2_auth.0.token_command"},
+								ConflictsWith: []string{"xoauth2_auth.0.token_command"},
+							},
+							"token_command": {
+								Type: schema.TypeString,
+								Description: `
+External command to run to obtain a fresh OAuth2 access token. It is executed
+every time a connection is authenticated rather than once per plan, since access
+tokens commonly expire well within the span of a single Terraform run. Messages
+sent over an already-open pooled connection do not run it again.
+Mutually exclusive with token.
+								`,
+								Optional:      true,
+								AtLeastOneOf:  []string{"xoauth2_auth.0.token", "xoauth2_auth.0.token_command"},
+								ConflictsWith: []string{"xoauth2_auth.0.token"},
+							},
+						},
+					},
+				},
+				"tls": {
+					Type:        schema.TypeList,
+					Description: "Transport security settings for the connection to the SMTP server",
+					Optional:    true,
+					MaxItems:    1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"mode": {
+								Type: schema.TypeString,
+								Description: `
+One of "none", "starttls", "starttls_required" or "implicit".
+"starttls" upgrades the connection if the server advertises support for it,
+"starttls_required" fails if it doesn't, "implicit" dials a TLS connection
+directly (e.g. for port 465), and "none" never encrypts the connection.
+Defaults to "starttls".
+								`,
+								Optional: true,
+								Default:  string(tlsModeSTARTTLS),
+								ValidateFunc: validation.StringInSlice([]string{
+									string(tlsModeNone),
+									string(tlsModeSTARTTLS),
+									string(tlsModeSTARTTLSRequired),
+									string(tlsModeImplicit),
+								}, false),
+							},
+							"insecure_skip_verify": {
+								Type:        schema.TypeBool,
+								Description: "Skip verification of the server's certificate chain and host name",
+								Optional:    true,
+								Default:     false,
+							},
+							"server_name": {
+								Type:        schema.TypeString,
+								Description: "Server name used for SNI and certificate verification. Defaults to the provider's host",
+								Optional:    true,
+							},
+							"ca_bundle": {
+								Type:        schema.TypeString,
+								Description: "PEM-encoded CA certificate bundle used to verify the server's certificate, instead of the system roots",
+								Optional:    true,
+							},
+							"ca_bundle_file": {
+								Type:        schema.TypeString,
+								Description: "Path to a PEM-encoded CA certificate bundle, as an alternative to ca_bundle",
+								Optional:    true,
+							},
+							"client_cert": {
+								Type:        schema.TypeString,
+								Description: "PEM-encoded client certificate to present for mutual TLS. Requires client_key",
+								Optional:    true,
+							},
+							"client_key": {
+								Type:        schema.TypeString,
+								Description: "PEM-encoded private key matching client_cert",
+								Optional:    true,
+								Sensitive:   true,
+							},
+							"allow_insecure_auth": {
+								Type:        schema.TypeBool,
+								Description: "Allow credential-revealing auth mechanisms such as plain_auth over an unencrypted connection",
+								Optional:    true,
+								Default:     false,
+							},
+						},
+					},
+				},
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"smtp_message": resourceMessage(),
+				"smtp_message":       resourceMessage(),
+				"smtp_mailer":        resourceMailer(),
+				"smtp_message_batch": resourceMessageBatch(),
+			},
+			DataSourcesMap: map[string]*schema.Resource{
+				"smtp_template": dataSourceTemplate(),
 			},
 		}
 
@@ -119,10 +356,31 @@ Can be passed using the SMTP_PLAIN_IDENTITY environment variable.
 }
 
 type client struct {
-	auth           smtp.Auth
 	host, username string
 	from           string
 	port           int
+
+	// auth builds the smtp.Auth to use for the connection. It takes the TLS
+	// channel binding data of the connection, which is only non-nil, and only
+	// used, for the SCRAM "-PLUS" mechanisms.
+	auth func(cbindData []byte) smtp.Auth
+
+	// authRequiresEncryption is true for mechanisms that reveal the password
+	// in a recoverable form (e.g. PLAIN, LOGIN), and must therefore refuse to
+	// run over an unencrypted connection unless the user opts out.
+	authRequiresEncryption bool
+
+	// authNeedsChannelBinding is true for the SCRAM "-PLUS" mechanisms, which
+	// cannot authenticate at all without TLS channel binding data.
+	authNeedsChannelBinding bool
+
+	tls *tlsSettings
+
+	// pool is the persistent connection shared by smtp_mailer and the
+	// resources that send over it (e.g. smtp_message_batch). It is always
+	// set; its connection is opened by smtp_mailer, or on the first send over
+	// the pool if no smtp_mailer opened it first.
+	pool *smtpPool
 }
 
 func configureClient(ctx context.Context, r *schema.ResourceData) (interface{}, diag.Diagnostics) {
@@ -131,6 +389,7 @@ func configureClient(ctx context.Context, r *schema.ResourceData) (interface{},
 		port:     r.Get("port").(int),
 		username: r.Get("username").(string),
 		from:     r.Get("from").(string),
+		pool:     &smtpPool{},
 	}
 
 	if cram, ok := r.GetOk("cram_md5_auth"); ok {
@@ -138,26 +397,101 @@ func configureClient(ctx context.Context, r *schema.ResourceData) (interface{},
 
 		if len(cramSettings) > 0 {
 			cramSettings := cramSettings[0].(map[string]interface{})
-			client.auth = smtp.CRAMMD5Auth(
-				client.username,
-				cramSettings["secret"].(string),
-			)
+			secret := cramSettings["secret"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				return smtp.CRAMMD5Auth(client.username, secret)
+			}
 		}
 	} else if plain, ok := r.GetOk("plain_auth"); ok {
 		plainSettings := plain.([]interface{})
 
 		if len(plainSettings) > 0 {
 			plainSettings := plainSettings[0].(map[string]interface{})
-			client.auth = smtp.PlainAuth(
-				plainSettings["identity"].(string),
-				client.username,
-				plainSettings["password"].(string),
-				client.host,
-			)
+			identity := plainSettings["identity"].(string)
+			password := plainSettings["password"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				return smtp.PlainAuth(identity, client.username, password, client.host)
+			}
+			client.authRequiresEncryption = true
+		}
+	} else if scram, ok := r.GetOk("scram_sha1_auth"); ok {
+		scramSettings := scram.([]interface{})
+
+		if len(scramSettings) > 0 {
+			scramSettings := scramSettings[0].(map[string]interface{})
+			password := scramSettings["password"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				return newScramAuth("SCRAM-SHA-1", sha1.New, client.username, password, nil)
+			}
+		}
+	} else if scram, ok := r.GetOk("scram_sha256_auth"); ok {
+		scramSettings := scram.([]interface{})
+
+		if len(scramSettings) > 0 {
+			scramSettings := scramSettings[0].(map[string]interface{})
+			password := scramSettings["password"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				return newScramAuth("SCRAM-SHA-256", sha256.New, client.username, password, nil)
+			}
+		}
+	} else if scram, ok := r.GetOk("scram_sha1_plus_auth"); ok {
+		scramSettings := scram.([]interface{})
+
+		if len(scramSettings) > 0 {
+			scramSettings := scramSettings[0].(map[string]interface{})
+			password := scramSettings["password"].(string)
+			client.auth = func(cbindData []byte) smtp.Auth {
+				return newScramAuth("SCRAM-SHA-1-PLUS", sha1.New, client.username, password, cbindData)
+			}
+			client.authNeedsChannelBinding = true
+		}
+	} else if scram, ok := r.GetOk("scram_sha256_plus_auth"); ok {
+		scramSettings := scram.([]interface{})
+
+		if len(scramSettings) > 0 {
+			scramSettings := scramSettings[0].(map[string]interface{})
+			password := scramSettings["password"].(string)
+			client.auth = func(cbindData []byte) smtp.Auth {
+				return newScramAuth("SCRAM-SHA-256-PLUS", sha256.New, client.username, password, cbindData)
+			}
+			client.authNeedsChannelBinding = true
+		}
+	} else if login, ok := r.GetOk("login_auth"); ok {
+		loginSettings := login.([]interface{})
+
+		if len(loginSettings) > 0 {
+			loginSettings := loginSettings[0].(map[string]interface{})
+			password := loginSettings["password"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				return newLoginAuth(client.username, password)
+			}
+			client.authRequiresEncryption = true
+		}
+	} else if xoauth2, ok := r.GetOk("xoauth2_auth"); ok {
+		xoauth2Settings := xoauth2.([]interface{})
+
+		if len(xoauth2Settings) > 0 {
+			xoauth2Settings := xoauth2Settings[0].(map[string]interface{})
+			token := xoauth2Settings["token"].(string)
+			tokenCommand := xoauth2Settings["token_command"].(string)
+			client.auth = func(_ []byte) smtp.Auth {
+				resolvedToken, err := resolveOAuthToken(token, tokenCommand)
+				if err != nil {
+					return failedAuth{err: err}
+				}
+				return newXOAuth2Auth(client.username, resolvedToken)
+			}
+			client.authRequiresEncryption = true
 		}
 	} else {
 		return nil, diag.Errorf("no authentication method specified")
 	}
 
+	tlsSettings, err := tlsSettingsFromResourceData(r, client.host)
+	if err != nil {
+		return nil, diag.Errorf("invalid tls settings: %s", err)
+	}
+	client.tls = tlsSettings
+
 	return client, nil
 }
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// providerFactories is shared by the resource.UnitTest-based acceptance tests
+// in this package.
+var providerFactories = map[string]func() (*schema.Provider, error){
+	"smtp": func() (*schema.Provider, error) {
+		return New("test")(), nil
+	},
+}
+
+// TestProvider_InternalValidate runs the same schema validation Terraform
+// performs on every ValidateProviderConfig RPC (i.e. every real plan/apply).
+// A single resource with a bad schema (e.g. a repeatable block referencing a
+// top-level-only AtLeastOneOf path) fails this for the whole provider, not
+// just that resource, so it's worth covering on its own.
+func TestProvider_InternalValidate(t *testing.T) {
+	if err := New("test")().InternalValidate(); err != nil {
+		t.Fatalf("InternalValidate: %v", err)
+	}
+}
+
+// TestConfigureClient_XOAuth2RequiresEncryption is a regression test: XOAUTH2
+// puts a bearer token on the wire in a trivially-reversible form, just like
+// plain_auth and login_auth, so it must refuse to run over an unencrypted
+// connection unless tls.allow_insecure_auth opts out, same as they do.
+func TestConfigureClient_XOAuth2RequiresEncryption(t *testing.T) {
+	raw := map[string]interface{}{
+		"host":     "smtp.example.com",
+		"username": "user@example.com",
+		"xoauth2_auth": []interface{}{
+			map[string]interface{}{"token": "tok"},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, New("test")().Schema, raw)
+
+	result, diags := configureClient(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("configureClient: %v", diags)
+	}
+
+	if !result.(*client).authRequiresEncryption {
+		t.Fatal("xoauth2_auth must set authRequiresEncryption")
+	}
+}
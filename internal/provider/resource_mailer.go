@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceMailer opens a single authenticated connection to the SMTP server
+// that is kept alive by the provider until the resource is destroyed or the
+// provider process exits (a later run reopens it on first use), so that other
+// resources (e.g. smtp_message_batch) can send over it without paying a
+// fresh dial/STARTTLS/AUTH round-trip per message.
+func resourceMailer() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Persistent connection to the SMTP server, reused by other resources to send messages without reconnecting for each one",
+		CreateContext: resourceMailerCreate,
+		ReadContext:   schema.NoopContext,
+		DeleteContext: resourceMailerDelete,
+		Schema:        map[string]*schema.Schema{},
+	}
+}
+
+func resourceMailerCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*client)
+
+	if err := client.pool.open(client); err != nil {
+		return diag.Errorf("failed to open connection to %s: %s", client.host, err)
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%s", client.host, client.port, client.username)))
+	d.SetId(fmt.Sprintf("%d-%x", time.Now().UnixNano(), sum))
+
+	return nil
+}
+
+func resourceMailerDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*client)
+
+	if err := client.pool.close(); err != nil {
+		return diag.Errorf("failed to close connection to %s: %s", client.host, err)
+	}
+
+	return nil
+}
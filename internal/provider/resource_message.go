@@ -1,33 +1,84 @@
 package provider
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
-	"io"
-	"net/smtp"
-	"net/textproto"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
-func recipientList(description string) *schema.Schema {
+// recipientList builds the schema for the "to"/"cc"/"bcc" fields. atLeastOneOf
+// is passed through to the schema.Schema field of the same name: the SDK only
+// allows absolute top-level attribute paths there, so it must be nil when this
+// is nested inside a repeatable block (e.g. smtp_message_batch's "message"
+// block) — see buildMessage for the manual equivalent in that case.
+func recipientList(description string, atLeastOneOf []string) *schema.Schema {
 	return &schema.Schema{
 		Type:         schema.TypeSet,
 		Elem:         &schema.Schema{Type: schema.TypeString},
 		Description:  description,
 		Optional:     true,
 		MinItems:     1,
-		AtLeastOneOf: []string{"to", "cc", "bcc"},
+		AtLeastOneOf: atLeastOneOf,
 		ForceNew:     true,
 	}
 }
 
+// attachmentList builds the schema for the repeatable "attachment" and
+// "inline" blocks, which share everything but the CID needed to reference an
+// inline part from the HTML body.
+func attachmentList(description string, inline bool) *schema.Schema {
+	elemSchema := map[string]*schema.Schema{
+		"filename": {
+			Type:        schema.TypeString,
+			Description: "Filename of the part, as seen by the recipient",
+			Required:    true,
+		},
+		"content_type": {
+			Type:        schema.TypeString,
+			Description: "MIME content type of the part. Defaults to application/octet-stream",
+			Optional:    true,
+			Default:     "application/octet-stream",
+		},
+		"content": {
+			Type:        schema.TypeString,
+			Description: "Raw content of the part. Mutually exclusive with content_base64 and source",
+			Optional:    true,
+		},
+		"content_base64": {
+			Type:        schema.TypeString,
+			Description: "Base64-encoded content of the part. Mutually exclusive with content and source",
+			Optional:    true,
+		},
+		"source": {
+			Type:        schema.TypeString,
+			Description: "Path to a local file to read the content from. Mutually exclusive with content and content_base64",
+			Optional:    true,
+		},
+	}
+
+	if inline {
+		elemSchema["content_id"] = &schema.Schema{
+			Type:        schema.TypeString,
+			Description: `The CID used to reference this part from an "img" tag in html_body, e.g. "cid:<content_id>"`,
+			Required:    true,
+		}
+	}
+
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: description,
+		Optional:    true,
+		ForceNew:    true,
+		Elem:        &schema.Resource{Schema: elemSchema},
+	}
+}
+
 func resourceMessage() *schema.Resource {
 	return &schema.Resource{
 		Description:   "Single SMTP message",
@@ -37,35 +88,62 @@ func resourceMessage() *schema.Resource {
 			return diag.FromErr(schema.RemoveFromState(d, nil))
 		},
 
-		Schema: map[string]*schema.Schema{
-			"subject": {
-				Type:        schema.TypeString,
-				Description: "Subject of the message",
-				Required:    true,
-				ForceNew:    true,
-			},
-			"body": {
-				Type:        schema.TypeString,
-				Description: "Body of the message",
-				Required:    true,
-				ForceNew:    true,
-			},
-			"from": {
-				Type:        schema.TypeString,
-				Description: "From field",
-				Optional:    true,
-				ForceNew:    true,
-			},
-			"to":  recipientList("Direct recipients of the message"),
-			"cc":  recipientList("CC recipients of the message"),
-			"bcc": recipientList("BCC recipients of the message"),
-			"headers": {
-				Type:        schema.TypeMap,
-				Elem:        &schema.Schema{Type: schema.TypeString},
-				Description: "Extra headers of the message",
-				Optional:    true,
-				ForceNew:    true,
-			},
+		Schema: messageFieldsSchema(true),
+	}
+}
+
+// messageFieldsSchema returns the schema for a single message: its subject,
+// bodies, recipients, headers and attachments. It is shared between
+// smtp_message and the repeatable "message" blocks of smtp_message_batch.
+//
+// topLevel must be true when the schema is used directly as a resource's
+// top-level Schema (smtp_message) and false when it's nested inside a
+// repeatable block (smtp_message_batch's "message" block): the "to"/"cc"/"bcc"
+// AtLeastOneOf constraint only works with top-level attribute paths, so it's
+// only set in the former case. buildMessage enforces the same constraint by
+// hand in the latter.
+func messageFieldsSchema(topLevel bool) map[string]*schema.Schema {
+	var recipientAtLeastOneOf []string
+	if topLevel {
+		recipientAtLeastOneOf = []string{"to", "cc", "bcc"}
+	}
+
+	return map[string]*schema.Schema{
+		"subject": {
+			Type:        schema.TypeString,
+			Description: "Subject of the message",
+			Required:    true,
+			ForceNew:    true,
+		},
+		"body": {
+			Type:        schema.TypeString,
+			Description: "Body of the message",
+			Required:    true,
+			ForceNew:    true,
+		},
+		"html_body": {
+			Type:        schema.TypeString,
+			Description: "HTML alternative of the body. When set, the message is sent as multipart/alternative with both body and html_body",
+			Optional:    true,
+			ForceNew:    true,
+		},
+		"attachment": attachmentList("Attachments of the message", false),
+		"inline":     attachmentList(`Inline parts of the message, referenced by CID from "img" tags in html_body`, true),
+		"from": {
+			Type:        schema.TypeString,
+			Description: "From field",
+			Optional:    true,
+			ForceNew:    true,
+		},
+		"to":  recipientList("Direct recipients of the message", recipientAtLeastOneOf),
+		"cc":  recipientList("CC recipients of the message", recipientAtLeastOneOf),
+		"bcc": recipientList("BCC recipients of the message", recipientAtLeastOneOf),
+		"headers": {
+			Type:        schema.TypeMap,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "Extra headers of the message",
+			Optional:    true,
+			ForceNew:    true,
 		},
 	}
 }
@@ -73,73 +151,154 @@ func resourceMessage() *schema.Resource {
 func resourceMessageCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*client)
 
-	buffer := bytes.NewBuffer(nil)
-	sumWriter := sha256.New()
-	msgWriter := textproto.NewWriter(bufio.NewWriter(buffer)).DotWriter()
-	writer := io.MultiWriter(sumWriter, msgWriter)
-
-	from := client.username
-	if client.from != "" {
-		from = client.from
-	}
-	if d.Get("from") != nil && d.Get("from").(string) != "" {
-		from = d.Get("from").(string)
+	message, recipients, err := buildMessage(d, defaultFrom(client))
+	if err != nil {
+		return diag.FromErr(err)
 	}
 
-	if _, err := fmt.Fprintln(writer, "From: ", from); err != nil {
-		return diag.Errorf("failed to write the From header: %v", err)
+	if err := sendMail(client, recipients, message); err != nil {
+		return diag.Errorf("Error sending message as %s: %s", client.username, err)
 	}
 
-	if _, err := fmt.Fprintln(writer, "Subject: ", d.Get("subject")); err != nil {
-		return diag.Errorf("failed to write the Subject header: %v", err)
+	sum := sha256.Sum256(message)
+	d.SetId(fmt.Sprintf("%d-%x", time.Now().UnixNano(), sum))
+
+	return nil
+}
+
+func defaultFrom(client *client) string {
+	if client.from != "" {
+		return client.from
 	}
+	return client.username
+}
 
-	to := asStringList(d.Get("to").(*schema.Set).List())
-	if len(to) > 0 {
-		if _, err := fmt.Fprintln(writer, "To: ", strings.Join(to, ", ")); err != nil {
-			return diag.Errorf("failed to write the To header: %v", err)
-		}
+// fieldGetter is the subset of *schema.ResourceData that buildMessage needs.
+// A nested "message" block from smtp_message_batch surfaces as a plain
+// map[string]interface{} rather than a *schema.ResourceData, so mapGetter
+// adapts it to the same interface.
+type fieldGetter interface {
+	Get(key string) interface{}
+}
+
+type mapGetter map[string]interface{}
+
+func (m mapGetter) Get(key string) interface{} {
+	return m[key]
+}
+
+// buildMessage reads the fields defined by messageFieldsSchema from g,
+// renders the MIME message and computes its recipients. It is shared by
+// smtp_message and smtp_message_batch.
+func buildMessage(g fieldGetter, defaultFrom string) ([]byte, []string, error) {
+	from := defaultFrom
+	if v, ok := g.Get("from").(string); ok && v != "" {
+		from = v
 	}
 
-	cc := asStringList(d.Get("cc").(*schema.Set).List())
-	if len(cc) > 0 {
-		if _, err := fmt.Fprintln(writer, "Cc: ", strings.Join(cc, ", ")); err != nil {
-			return diag.Errorf("failed to write the Cc header: %v", err)
-		}
+	to := asStringList(g.Get("to").(*schema.Set).List())
+	cc := asStringList(g.Get("cc").(*schema.Set).List())
+	bcc := asStringList(g.Get("bcc").(*schema.Set).List())
+
+	// smtp_message enforces this with the "to"/"cc"/"bcc" fields' AtLeastOneOf;
+	// nested smtp_message_batch "message" blocks can't use AtLeastOneOf (it
+	// only supports top-level attribute paths), so it's checked here instead.
+	if len(to) == 0 && len(cc) == 0 && len(bcc) == 0 {
+		return nil, nil, fmt.Errorf("at least one of to, cc or bcc must be set")
 	}
 
-	for k, v := range d.Get("headers").(map[string]interface{}) {
-		if _, err := fmt.Fprintln(writer, k, ": ", v); err != nil {
-			return diag.Errorf("failed to write the %s header: %v", k, err)
-		}
+	headers := make(map[string]string)
+	for k, v := range g.Get("headers").(map[string]interface{}) {
+		headers[k] = v.(string)
 	}
 
-	// Write the body
-	if _, err := fmt.Fprintln(writer); err != nil {
-		return diag.Errorf("failed to write the body separator: %v", err)
+	attachments, err := attachmentsFromList(g.Get("attachment").([]interface{}), false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read attachments: %w", err)
 	}
 
-	if _, err := fmt.Fprint(writer, d.Get("body")); err != nil {
-		return diag.Errorf("failed to write the body: %v", err)
+	inlineAttachments, err := attachmentsFromList(g.Get("inline").([]interface{}), true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read inline parts: %w", err)
 	}
 
-	if err := msgWriter.Close(); err != nil {
-		return diag.Errorf("failed to close the message writer: %v", err)
+	message, err := renderMessage(messageInput{
+		from:        from,
+		subject:     g.Get("subject").(string),
+		to:          to,
+		cc:          cc,
+		headers:     headers,
+		textBody:    g.Get("body").(string),
+		htmlBody:    g.Get("html_body").(string),
+		attachments: append(attachments, inlineAttachments...),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render the message: %w", err)
 	}
 
-	// Calculate the SHA256 hash of the message
-	host := fmt.Sprintf("%s:%d", client.host, client.port)
+	return message, uniqueRecipients(to, cc, bcc), nil
+}
 
-	// Define the recipients of the message.
-	recipients := uniqueRecipients(to, cc, asStringList(d.Get("bcc").(*schema.Set).List()))
+// attachmentsFromList reads the repeatable attachment/inline blocks in raw.
+func attachmentsFromList(raw []interface{}, inline bool) ([]messageAttachment, error) {
+	attachments := make([]messageAttachment, 0, len(raw))
+	for _, item := range raw {
+		m := item.(map[string]interface{})
 
-	if err := smtp.SendMail(host, client.auth, client.username, recipients, buffer.Bytes()); err != nil {
-		return diag.Errorf("Error sending message as %s: %s", client.username, err)
+		content, err := resolveAttachmentContent(m)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", m["filename"], err)
+		}
+
+		a := messageAttachment{
+			filename:    m["filename"].(string),
+			contentType: m["content_type"].(string),
+			content:     content,
+			inline:      inline,
+		}
+		if inline {
+			a.contentID = m["content_id"].(string)
+		}
+
+		attachments = append(attachments, a)
 	}
 
-	d.SetId(fmt.Sprintf("%d-%x", time.Now().UnixNano(), sumWriter.Sum(nil)))
+	return attachments, nil
+}
 
-	return nil
+// resolveAttachmentContent reads the content of an attachment/inline block
+// from whichever of content, content_base64 or source was set.
+func resolveAttachmentContent(m map[string]interface{}) ([]byte, error) {
+	content := m["content"].(string)
+	contentBase64 := m["content_base64"].(string)
+	source := m["source"].(string)
+
+	set := 0
+	for _, v := range []string{content, contentBase64, source} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of content, content_base64 or source must be set")
+	}
+
+	switch {
+	case content != "":
+		return []byte(content), nil
+	case contentBase64 != "":
+		decoded, err := base64.StdEncoding.DecodeString(contentBase64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content_base64: %w", err)
+		}
+		return decoded, nil
+	default:
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source %q: %w", source, err)
+		}
+		return data, nil
+	}
 }
 
 func asStringList(in []interface{}) []string {
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceMessageBatch sends a list of messages over the provider's pooled
+// connection (see smtp_mailer), pipelining each message's RCPT TO commands
+// when the server supports it.
+func resourceMessageBatch() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A list of SMTP messages sent over the connection opened by smtp_mailer",
+		CreateContext: resourceMessageBatchCreate,
+		ReadContext:   schema.NoopContext,
+		DeleteContext: func(_ context.Context, d *schema.ResourceData, _ interface{}) diag.Diagnostics {
+			return diag.FromErr(schema.RemoveFromState(d, nil))
+		},
+		Schema: map[string]*schema.Schema{
+			"message": {
+				Type:        schema.TypeList,
+				Description: "A message to send; see smtp_message for the meaning of each field",
+				Required:    true,
+				MinItems:    1,
+				ForceNew:    true,
+				Elem:        &schema.Resource{Schema: messageFieldsSchema(false)},
+			},
+		},
+	}
+}
+
+func resourceMessageBatchCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*client)
+
+	messages := d.Get("message").([]interface{})
+
+	sum := sha256.New()
+	for i, item := range messages {
+		message, recipients, err := buildMessage(mapGetter(item.(map[string]interface{})), defaultFrom(client))
+		if err != nil {
+			return diag.Errorf("message %d: %s", i, err)
+		}
+
+		if err := client.pool.send(client, recipients, message); err != nil {
+			return diag.Errorf("message %d: error sending as %s: %s", i, client.username, err)
+		}
+
+		sum.Write(message)
+	}
+
+	d.SetId(fmt.Sprintf("%d-%x", time.Now().UnixNano(), sum.Sum(nil)))
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+type tlsMode string
+
+const (
+	tlsModeNone             tlsMode = "none"
+	tlsModeSTARTTLS         tlsMode = "starttls"
+	tlsModeSTARTTLSRequired tlsMode = "starttls_required"
+	tlsModeImplicit         tlsMode = "implicit"
+)
+
+// tlsSettings holds the provider's "tls" block, controlling how (and whether)
+// the connection to the SMTP server is encrypted.
+type tlsSettings struct {
+	mode              tlsMode
+	config            *tls.Config
+	allowInsecureAuth bool
+}
+
+// tlsSettingsFromResourceData reads the "tls" block, defaulting to opportunistic
+// STARTTLS when it isn't set at all.
+func tlsSettingsFromResourceData(r *schema.ResourceData, defaultServerName string) (*tlsSettings, error) {
+	raw, ok := r.GetOk("tls")
+	if !ok {
+		return &tlsSettings{
+			mode:   tlsModeSTARTTLS,
+			config: &tls.Config{ServerName: defaultServerName},
+		}, nil
+	}
+
+	settings := raw.([]interface{})
+	if len(settings) == 0 {
+		return &tlsSettings{
+			mode:   tlsModeSTARTTLS,
+			config: &tls.Config{ServerName: defaultServerName},
+		}, nil
+	}
+
+	return buildTLSSettings(settings[0].(map[string]interface{}), defaultServerName)
+}
+
+func buildTLSSettings(raw map[string]interface{}, defaultServerName string) (*tlsSettings, error) {
+	cfg := &tls.Config{
+		ServerName:         defaultServerName,
+		InsecureSkipVerify: raw["insecure_skip_verify"].(bool),
+	}
+	if serverName := raw["server_name"].(string); serverName != "" {
+		cfg.ServerName = serverName
+	}
+
+	pool, err := caCertPool(raw["ca_bundle"].(string), raw["ca_bundle_file"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if pool != nil {
+		cfg.RootCAs = pool
+	}
+
+	clientCert := raw["client_cert"].(string)
+	clientKey := raw["client_key"].(string)
+	if clientCert != "" || clientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client_cert/client_key: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return &tlsSettings{
+		mode:              tlsMode(raw["mode"].(string)),
+		config:            cfg,
+		allowInsecureAuth: raw["allow_insecure_auth"].(bool),
+	}, nil
+}
+
+// caCertPool builds the certificate pool to verify the server against, from
+// whichever of ca_bundle or ca_bundle_file was set. It returns a nil pool,
+// meaning "use the system roots", if neither was set.
+func caCertPool(bundle, bundleFile string) (*x509.CertPool, error) {
+	if bundle == "" && bundleFile == "" {
+		return nil, nil
+	}
+
+	if bundleFile != "" {
+		data, err := os.ReadFile(bundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_bundle_file: %w", err)
+		}
+		bundle += "\n" + string(data)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, fmt.Errorf("no valid certificates found in ca_bundle/ca_bundle_file")
+	}
+
+	return pool, nil
+}
+
+// dialAuthenticated dials and authenticates a fresh *smtp.Client according to
+// client.tls, refusing to use a credential-revealing auth mechanism over an
+// unencrypted connection unless explicitly allowed. The caller owns the
+// returned client and is responsible for closing or quitting it.
+func dialAuthenticated(client *client) (*smtp.Client, error) {
+	host := net.JoinHostPort(client.host, strconv.Itoa(client.port))
+
+	var conn net.Conn
+	var err error
+	if client.tls.mode == tlsModeImplicit {
+		conn, err = tls.Dial("tcp", host, client.tls.config)
+	} else {
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", host, err)
+	}
+
+	c, err := smtp.NewClient(conn, client.host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+
+	encrypted := client.tls.mode == tlsModeImplicit
+
+	if client.tls.mode == tlsModeSTARTTLS || client.tls.mode == tlsModeSTARTTLSRequired {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(client.tls.config); err != nil {
+				c.Close()
+				return nil, fmt.Errorf("STARTTLS failed: %w", err)
+			}
+			encrypted = true
+		} else if client.tls.mode == tlsModeSTARTTLSRequired {
+			c.Close()
+			return nil, fmt.Errorf("server does not support STARTTLS")
+		}
+	}
+
+	if client.authRequiresEncryption && !encrypted && !client.tls.allowInsecureAuth {
+		c.Close()
+		return nil, fmt.Errorf("refusing to authenticate over an unencrypted connection; set tls.allow_insecure_auth to override")
+	}
+
+	var cbindData []byte
+	if encrypted {
+		if state, ok := c.TLSConnectionState(); ok {
+			if cbindData, err = tlsServerEndpointBinding(state); err != nil && client.authNeedsChannelBinding {
+				c.Close()
+				return nil, fmt.Errorf("failed to compute channel binding data: %w", err)
+			}
+		}
+	}
+	if client.authNeedsChannelBinding && cbindData == nil {
+		c.Close()
+		return nil, fmt.Errorf("channel-binding auth mechanisms require an encrypted connection")
+	}
+
+	if client.auth != nil {
+		if err := c.Auth(client.auth(cbindData)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// sendOverClient sends a single message over an already-dialed and
+// authenticated c, pipelining the RCPT TO commands per RFC 2920 when the
+// server advertises support for it.
+func sendOverClient(c *smtp.Client, from string, recipients []string, msg []byte) error {
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+
+	if err := rcptAll(c, recipients); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message body: %w", err)
+	}
+
+	return w.Close()
+}
+
+// rcptAll issues a RCPT TO command for every recipient, pipelining them
+// together in a single round-trip when the server advertises PIPELINING, and
+// falling back to one-at-a-time otherwise.
+func rcptAll(c *smtp.Client, recipients []string) error {
+	if ok, _ := c.Extension("PIPELINING"); !ok {
+		for _, recipient := range recipients {
+			if err := c.Rcpt(recipient); err != nil {
+				return fmt.Errorf("RCPT TO %s failed: %w", recipient, err)
+			}
+		}
+		return nil
+	}
+
+	// c.Text.Cmd, unlike c.Rcpt, doesn't validate its argument, so a recipient
+	// containing a CR or LF would otherwise inject arbitrary extra SMTP
+	// commands into the pipelined batch below.
+	for _, recipient := range recipients {
+		if err := validateLine(recipient); err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	ids := make([]uint, len(recipients))
+	for i, recipient := range recipients {
+		id, err := c.Text.Cmd("RCPT TO:<%s>", recipient)
+		if err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", recipient, err)
+		}
+		ids[i] = id
+	}
+
+	for i, recipient := range recipients {
+		c.Text.StartResponse(ids[i])
+		_, _, err := c.Text.ReadResponse(25)
+		c.Text.EndResponse(ids[i])
+		if err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	return nil
+}
+
+// validateLine mirrors the unexported check net/smtp's Client.Rcpt/Mail/Hello
+// perform on every line before writing it to the wire: a CR or LF would let
+// its caller inject arbitrary extra SMTP command lines.
+func validateLine(line string) error {
+	if strings.ContainsAny(line, "\n\r") {
+		return fmt.Errorf("smtp: a line must not contain CR or LF")
+	}
+	return nil
+}
+
+// sendMail delivers msg to recipients over a one-shot connection: dial,
+// authenticate, send and quit. It is used by smtp_message, which doesn't
+// reuse a connection across resources.
+func sendMail(client *client, recipients []string, msg []byte) error {
+	c, err := dialAuthenticated(client)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := sendOverClient(c, client.username, recipients, msg); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestValidateLine(t *testing.T) {
+	if err := validateLine("victim@example.com"); err != nil {
+		t.Errorf("validateLine rejected a clean address: %v", err)
+	}
+	if err := validateLine("victim@example.com>\r\nRCPT TO:<attacker@evil.com"); err == nil {
+		t.Fatal("validateLine accepted a recipient containing CRLF")
+	}
+}
+
+// TestRcptAll_RejectsInjectedRecipient is a regression test: rcptAll used to
+// hand recipients straight to c.Text.Cmd in the pipelined branch, which
+// doesn't validate its argument, so a recipient containing CRLF injected
+// arbitrary extra SMTP command lines once the pipelined batch was built.
+func TestRcptAll_RejectsInjectedRecipient(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	serverLines := make(chan string, 16)
+	go fakePipeliningServer(serverConn, serverLines)
+
+	c, err := smtp.NewClient(clientConn, "localhost")
+	if err != nil {
+		t.Fatalf("smtp.NewClient: %v", err)
+	}
+	defer c.Close()
+
+	malicious := "victim@example.com>\r\nRCPT TO:<attacker@evil.com"
+	err = rcptAll(c, []string{malicious})
+	if err == nil {
+		t.Fatal("expected rcptAll to reject a recipient containing CRLF, got nil error")
+	}
+
+	close(serverLines)
+	for line := range serverLines {
+		if strings.Contains(line, "attacker@evil.com") {
+			t.Fatalf("injected RCPT command reached the wire: %q", line)
+		}
+	}
+}
+
+// fakePipeliningServer is a minimal SMTP server that advertises PIPELINING
+// and records every command line it receives.
+func fakePipeliningServer(conn net.Conn, lines chan<- string) {
+	defer conn.Close()
+
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		lines <- line
+
+		switch {
+		case strings.HasPrefix(strings.ToUpper(line), "EHLO"):
+			tc.PrintfLine("250-localhost")
+			tc.PrintfLine("250 PIPELINING")
+		case strings.HasPrefix(strings.ToUpper(line), "QUIT"):
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestCACertPool_NoneConfigured(t *testing.T) {
+	pool, err := caCertPool("", "")
+	if err != nil {
+		t.Fatalf("caCertPool: %v", err)
+	}
+	if pool != nil {
+		t.Fatalf("expected a nil pool (system roots) when neither ca_bundle nor ca_bundle_file is set, got %v", pool)
+	}
+}
+
+func TestCACertPool_InvalidBundle(t *testing.T) {
+	if _, err := caCertPool("not a valid PEM bundle", ""); err == nil {
+		t.Fatal("expected an error for an invalid ca_bundle, got nil")
+	}
+}
+
+func TestCACertPool_MissingFile(t *testing.T) {
+	if _, err := caCertPool("", "/nonexistent/ca-bundle.pem"); err == nil {
+		t.Fatal("expected an error for a missing ca_bundle_file, got nil")
+	}
+}